@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+)
+
+// EKSDescribeClusterAPI is the subset of the EKS client needed to resolve a
+// cluster's service CIDR. Scoping it down to DescribeCluster keeps callers
+// testable without depending on the full EKS client surface.
+type EKSDescribeClusterAPI interface {
+	DescribeCluster(ctx context.Context, input *eks.DescribeClusterInput, optFns ...func(*eks.Options)) (*eks.DescribeClusterOutput, error)
+}
+
+// clusterServiceCIDR holds the resolved service CIDRs for a cluster.
+type clusterServiceCIDR struct {
+	IPv4 string
+	IPv6 string
+}
+
+// clusterCIDRCacheKey disambiguates cached entries by both the EKS client used
+// to resolve them and the cluster name. EKS cluster names are only unique
+// per-account-per-region, and CAPA reconciles clusters across many accounts,
+// so clusterName alone is not a safe cache key: two unrelated clusters named
+// e.g. "prod" in different accounts would otherwise collide and the second
+// one to resolve would silently get the first one's service CIDR. Callers
+// construct a distinct EKSDescribeClusterAPI per target account/region (e.g.
+// one EKS client per assumed role), so keying on the client as well as the
+// cluster name keeps entries scoped to the cluster they were actually
+// resolved from.
+type clusterCIDRCacheKey struct {
+	client      EKSDescribeClusterAPI
+	clusterName string
+}
+
+// clusterCIDRCache caches the resolved service CIDR per clusterCIDRCacheKey
+// for the lifetime of the process, one DescribeCluster call per cluster,
+// similar to how Karpenter's AWS provider resolves and caches its cluster
+// CIDR once. Each entry is an atomic pointer so concurrent resolutions for
+// the same key never race on the cached value.
+var clusterCIDRCache sync.Map // map[clusterCIDRCacheKey]*atomic.Pointer[clusterServiceCIDR]
+
+// resolveClusterServiceCIDR returns the cached service CIDR for clusterName as
+// resolved through client, calling DescribeCluster to populate the cache on
+// first use.
+func resolveClusterServiceCIDR(ctx context.Context, client EKSDescribeClusterAPI, clusterName string) (*clusterServiceCIDR, error) {
+	key := clusterCIDRCacheKey{client: client, clusterName: clusterName}
+	if v, ok := clusterCIDRCache.Load(key); ok {
+		if cidr := v.(*atomic.Pointer[clusterServiceCIDR]).Load(); cidr != nil {
+			return cidr, nil
+		}
+	}
+
+	out, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(clusterName)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EKS cluster %q to resolve service CIDR: %w", clusterName, err)
+	}
+	if out.Cluster == nil || out.Cluster.KubernetesNetworkConfig == nil {
+		return nil, fmt.Errorf("EKS cluster %q has no Kubernetes network config to resolve service CIDR from", clusterName)
+	}
+
+	cidr := &clusterServiceCIDR{
+		IPv4: aws.ToString(out.Cluster.KubernetesNetworkConfig.ServiceIpv4Cidr),
+		IPv6: aws.ToString(out.Cluster.KubernetesNetworkConfig.ServiceIpv6Cidr),
+	}
+	if cidr.IPv4 == "" && cidr.IPv6 == "" {
+		// Nothing resolved, e.g. the cluster's network config hasn't propagated
+		// yet. Don't cache a permanently empty result; let the next call retry
+		// DescribeCluster instead of failing for the life of the process.
+		return cidr, nil
+	}
+
+	p := &atomic.Pointer[clusterServiceCIDR]{}
+	p.Store(cidr)
+	actual, _ := clusterCIDRCache.LoadOrStore(key, p)
+	return actual.(*atomic.Pointer[clusterServiceCIDR]).Load(), nil
+}
+
+// deriveDNSClusterIP computes the cluster DNS service IP from a service CIDR,
+// following the EKS convention of the 10th address in the range (.10 for IPv4,
+// ::a for IPv6).
+func deriveDNSClusterIP(cidr string) (string, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse service CIDR %q: %w", cidr, err)
+	}
+
+	i := new(big.Int).SetBytes(network.IP)
+	i.Add(i, big.NewInt(10))
+
+	raw := i.Bytes()
+	padded := make([]byte, len(network.IP))
+	copy(padded[len(padded)-len(raw):], raw)
+
+	return net.IP(padded).String(), nil
+}
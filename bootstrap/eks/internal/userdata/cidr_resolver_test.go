@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+	. "github.com/onsi/gomega"
+)
+
+type fakeDescribeClusterAPI struct {
+	calls  int
+	ipv4   string
+	ipv6   string
+	errOut error
+}
+
+func (f *fakeDescribeClusterAPI) DescribeCluster(_ context.Context, _ *eks.DescribeClusterInput, _ ...func(*eks.Options)) (*eks.DescribeClusterOutput, error) {
+	f.calls++
+	if f.errOut != nil {
+		return nil, f.errOut
+	}
+	return &eks.DescribeClusterOutput{
+		Cluster: &ekstypes.Cluster{
+			KubernetesNetworkConfig: &ekstypes.KubernetesNetworkConfigResponse{
+				ServiceIpv4Cidr: aws.String(f.ipv4),
+				ServiceIpv6Cidr: aws.String(f.ipv6),
+			},
+		},
+	}, nil
+}
+
+func TestResolveClusterServiceCIDR(t *testing.T) {
+	g := NewWithT(t)
+
+	client := &fakeDescribeClusterAPI{ipv4: "192.168.0.0/16"}
+	cidr, err := resolveClusterServiceCIDR(context.Background(), client, "resolve-cache-test-cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cidr.IPv4).To(Equal("192.168.0.0/16"))
+
+	// A second resolution for the same cluster name should be served from cache.
+	_, err = resolveClusterServiceCIDR(context.Background(), client, "resolve-cache-test-cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(client.calls).To(Equal(1))
+}
+
+func TestResolveClusterServiceCIDRDoesNotCacheEmptyResult(t *testing.T) {
+	g := NewWithT(t)
+
+	client := &fakeDescribeClusterAPI{}
+	cidr, err := resolveClusterServiceCIDR(context.Background(), client, "resolve-empty-test-cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cidr.IPv4).To(BeEmpty())
+	g.Expect(cidr.IPv6).To(BeEmpty())
+
+	// The cluster's network config has since propagated; the unresolved result
+	// above must not have been cached, so this call should hit the API again.
+	client.ipv4 = "192.168.0.0/16"
+	cidr, err = resolveClusterServiceCIDR(context.Background(), client, "resolve-empty-test-cluster")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cidr.IPv4).To(Equal("192.168.0.0/16"))
+	g.Expect(client.calls).To(Equal(2))
+}
+
+func TestResolveClusterServiceCIDRKeyedPerClient(t *testing.T) {
+	g := NewWithT(t)
+
+	// Two distinct EKS clients (e.g. one per AWS account/region) resolving a
+	// cluster name that collides, since EKS cluster names are only unique
+	// per-account-per-region. Each client's result must be cached and
+	// returned independently instead of the second resolution reusing the
+	// first client's cached CIDR.
+	clientA := &fakeDescribeClusterAPI{ipv4: "192.168.0.0/16"}
+	clientB := &fakeDescribeClusterAPI{ipv4: "10.100.0.0/16"}
+
+	cidrA, err := resolveClusterServiceCIDR(context.Background(), clientA, "prod")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cidrA.IPv4).To(Equal("192.168.0.0/16"))
+
+	cidrB, err := resolveClusterServiceCIDR(context.Background(), clientB, "prod")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cidrB.IPv4).To(Equal("10.100.0.0/16"))
+
+	g.Expect(clientA.calls).To(Equal(1))
+	g.Expect(clientB.calls).To(Equal(1))
+}
+
+func TestDeriveDNSClusterIP(t *testing.T) {
+	g := NewWithT(t)
+
+	ipv4, err := deriveDNSClusterIP("192.168.0.0/16")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ipv4).To(Equal("192.168.0.10"))
+
+	ipv6, err := deriveDNSClusterIP("fd00::/108")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ipv6).To(Equal("fd00::a"))
+
+	_, err = deriveDNSClusterIP("not-a-cidr")
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+)
+
+// maxUserDataBytes is the EC2 instance user data size limit.
+const maxUserDataBytes = 16 * 1024
+
+// CompressionMode selects how NewNode compresses the rendered userdata.
+type CompressionMode string
+
+const (
+	// CompressionNone returns the rendered userdata as-is. This is the default.
+	CompressionNone CompressionMode = "none"
+	// CompressionGzip gzips the rendered userdata. cloud-init transparently
+	// decompresses gzip user data before handing it to nodeadm, but Ignition
+	// reads user data raw, so CompressionGzip is rejected for FormatIgnition.
+	CompressionGzip CompressionMode = "gzip"
+)
+
+// finalizeUserData applies input.Compression to raw and fails if the result
+// would still exceed the EC2 user data size limit, so callers find out at
+// render time rather than at RunInstances time.
+func finalizeUserData(input *NodeInput, raw []byte) ([]byte, error) {
+	if input.Format == FormatIgnition && input.Compression == CompressionGzip {
+		return nil, fmt.Errorf("compression %q is not supported for userdata format %q: Ignition reads user data raw, it does not gunzip it", CompressionGzip, FormatIgnition)
+	}
+
+	out := raw
+
+	if input.Compression == CompressionGzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(raw); err != nil {
+			return nil, fmt.Errorf("failed to gzip userdata: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip userdata: %w", err)
+		}
+		out = buf.Bytes()
+	}
+
+	if len(out) > maxUserDataBytes {
+		return nil, fmt.Errorf("rendered userdata is %d bytes, which exceeds the %d byte EC2 user data limit", len(out), maxUserDataBytes)
+	}
+
+	return out, nil
+}
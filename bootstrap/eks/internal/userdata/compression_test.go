@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewNodeGzipCompression(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{
+		ClusterName:       "test-cluster",
+		APIServerEndpoint: "https://example.com",
+		CACert:            "test-ca-cert",
+		NodeGroupName:     "test-nodegroup",
+		Compression:       CompressionGzip,
+	}
+
+	out, err := NewNode(input)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	gz, err := gzip.NewReader(bytes.NewReader(out))
+	g.Expect(err).NotTo(HaveOccurred())
+	decompressed, err := io.ReadAll(gz)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(strings.Contains(string(decompressed), "apiVersion: node.eks.aws/v1alpha1")).To(BeTrue())
+}
+
+func TestFinalizeUserDataRejectsIgnitionGzip(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{Format: FormatIgnition, Compression: CompressionGzip}
+	_, err := finalizeUserData(input, []byte("{}"))
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("Ignition"))
+}
+
+func TestFinalizeUserDataRejectsOversizedPayload(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{Compression: CompressionNone}
+	_, err := finalizeUserData(input, make([]byte, maxUserDataBytes+1))
+	g.Expect(err).To(HaveOccurred())
+}
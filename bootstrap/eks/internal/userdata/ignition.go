@@ -0,0 +1,342 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	eksbootstrapv1 "sigs.k8s.io/cluster-api-provider-aws/v2/bootstrap/eks/api/v1beta2"
+)
+
+const (
+	ignitionVersion     = "3.4.0"
+	nodeConfigFilePath  = "/etc/eks/nodeadm/config.yaml"
+	bootstrapScriptPath = "/etc/eks/bootstrap-commands.sh"
+	bootstrapUnitName   = "eks-bootstrap-commands.service"
+)
+
+// The types below are a minimal hand-rolled subset of the Ignition v3.4 config
+// schema (https://coreos.github.io/ignition/configuration-v3_4/) covering the
+// fields this package needs to render. They avoid pulling in the full Ignition
+// config module just to marshal a handful of fields to JSON.
+
+type ignitionConfig struct {
+	Ignition ignitionMeta    `json:"ignition"`
+	Storage  ignitionStorage `json:"storage,omitempty"`
+	Systemd  ignitionSystemd `json:"systemd,omitempty"`
+	Passwd   ignitionPasswd  `json:"passwd,omitempty"`
+}
+
+type ignitionMeta struct {
+	Version string `json:"version"`
+}
+
+type ignitionStorage struct {
+	Directories []ignitionDirectory  `json:"directories,omitempty"`
+	Disks       []ignitionDisk       `json:"disks,omitempty"`
+	Filesystems []ignitionFilesystem `json:"filesystems,omitempty"`
+	Files       []ignitionFile       `json:"files,omitempty"`
+}
+
+type ignitionFile struct {
+	Path      string               `json:"path"`
+	Overwrite *bool                `json:"overwrite,omitempty"`
+	Contents  ignitionFileContents `json:"contents"`
+	Mode      *int                 `json:"mode,omitempty"`
+}
+
+type ignitionFileContents struct {
+	Source string `json:"source"`
+}
+
+type ignitionDirectory struct {
+	Path      string `json:"path"`
+	Overwrite *bool  `json:"overwrite,omitempty"`
+	Mode      *int   `json:"mode,omitempty"`
+}
+
+type ignitionDisk struct {
+	Device     string              `json:"device"`
+	WipeTable  bool                `json:"wipeTable,omitempty"`
+	Partitions []ignitionPartition `json:"partitions,omitempty"`
+}
+
+type ignitionPartition struct {
+	Label    string `json:"label,omitempty"`
+	Number   int    `json:"number,omitempty"`
+	SizeMiB  *int   `json:"sizeMiB,omitempty"`
+	StartMiB *int   `json:"startMiB,omitempty"`
+}
+
+type ignitionFilesystem struct {
+	Device         string `json:"device"`
+	Format         string `json:"format"`
+	Label          string `json:"label,omitempty"`
+	Path           string `json:"path,omitempty"`
+	WipeFilesystem bool   `json:"wipeFilesystem,omitempty"`
+}
+
+type ignitionSystemd struct {
+	Units []ignitionUnit `json:"units,omitempty"`
+}
+
+type ignitionUnit struct {
+	Name     string `json:"name"`
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Contents string `json:"contents,omitempty"`
+}
+
+type ignitionPasswd struct {
+	Users []ignitionUser `json:"users,omitempty"`
+}
+
+type ignitionUser struct {
+	Name              string   `json:"name"`
+	PasswordHash      string   `json:"passwordHash,omitempty"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+	Shell             string   `json:"shell,omitempty"`
+}
+
+// newIgnitionNode renders the NodeInput as an Ignition v3.x config instead of
+// MIME-multipart cloud-init, for operating systems such as Flatcar that only
+// ingest Ignition.
+func newIgnitionNode(input *NodeInput) ([]byte, error) {
+	cfg := ignitionConfig{
+		Ignition: ignitionMeta{Version: ignitionVersion},
+	}
+
+	nodeConfigYAML, err := renderNodeConfigYAML(input)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Storage.Files = append(cfg.Storage.Files, dataURLFile(nodeConfigFilePath, 0o600, nodeConfigYAML))
+
+	if unit, file, ok := bootstrapCommandsUnit(input); ok {
+		cfg.Storage.Files = append(cfg.Storage.Files, file)
+		cfg.Systemd.Units = append(cfg.Systemd.Units, unit)
+	}
+
+	for _, f := range input.Files {
+		file, err := fileToIgnition(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render file %q as ignition storage file: %w", f.Path, err)
+		}
+		cfg.Storage.Files = append(cfg.Storage.Files, file)
+	}
+
+	if input.DiskSetup != nil {
+		for _, partition := range input.DiskSetup.Partitions {
+			// disk_setup's table_type/layout partition a whole device with a
+			// single partition spanning it, so there's only ever partition 1.
+			cfg.Storage.Disks = append(cfg.Storage.Disks, ignitionDisk{
+				Device:     partition.Device,
+				WipeTable:  partition.Overwrite != nil && *partition.Overwrite,
+				Partitions: []ignitionPartition{{Number: 1}},
+			})
+		}
+		for _, fs := range input.DiskSetup.Filesystems {
+			cfg.Storage.Filesystems = append(cfg.Storage.Filesystems, ignitionFilesystem{
+				Device:         fs.Device,
+				Format:         fs.Filesystem,
+				Label:          fs.Label,
+				WipeFilesystem: fs.Overwrite != nil && *fs.Overwrite,
+			})
+		}
+	}
+
+	// Ignition mounts a filesystem at boot by setting its storage.filesystems
+	// Path, rather than through a separate fstab-style mounts list, so splice
+	// each mount's target path into the filesystem it names by device.
+	for _, m := range input.Mounts {
+		if len(m) < 2 {
+			continue
+		}
+		device, path := m[0], m[1]
+		if i := filesystemIndexByDevice(cfg.Storage.Filesystems, device); i >= 0 {
+			cfg.Storage.Filesystems[i].Path = path
+			continue
+		}
+		cfg.Storage.Directories = append(cfg.Storage.Directories, ignitionDirectory{Path: path})
+	}
+
+	for _, user := range input.Users {
+		var groups []string
+		if user.Groups != nil && *user.Groups != "" {
+			groups = strings.Split(*user.Groups, ",")
+		}
+		cfg.Passwd.Users = append(cfg.Passwd.Users, ignitionUser{
+			Name:              user.Name,
+			PasswordHash:      derefString(user.Passwd),
+			SSHAuthorizedKeys: sshKeysToStrings(user.SSHAuthorizedKeys),
+			Groups:            groups,
+			Shell:             derefString(user.Shell),
+		})
+	}
+
+	if input.NTP != nil && len(input.NTP.Servers) > 0 {
+		cfg.Storage.Files = append(cfg.Storage.Files, dataURLFile("/etc/systemd/timesyncd.conf.d/90-eks.conf", 0o644,
+			fmt.Sprintf("[Time]\nNTP=%s\n", strings.Join(input.NTP.Servers, " "))))
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ignition config: %v", err)
+	}
+	return out, nil
+}
+
+// bootstrapCommandsUnit bundles PreBootstrapCommands/PostBootstrapCommands into a
+// shell script file plus a oneshot systemd unit that executes it.
+func bootstrapCommandsUnit(input *NodeInput) (ignitionUnit, ignitionFile, bool) {
+	if len(input.PreBootstrapCommands) == 0 && len(input.PostBootstrapCommands) == 0 {
+		return ignitionUnit{}, ignitionFile{}, false
+	}
+
+	var script strings.Builder
+	script.WriteString("#!/bin/bash\nset -o errexit\nset -o pipefail\nset -o nounset\n")
+	for _, cmd := range input.PreBootstrapCommands {
+		script.WriteString(cmd + "\n")
+	}
+	for _, cmd := range input.PostBootstrapCommands {
+		script.WriteString(cmd + "\n")
+	}
+
+	file := dataURLFile(bootstrapScriptPath, 0o755, script.String())
+
+	enabled := true
+	unit := ignitionUnit{
+		Name:    bootstrapUnitName,
+		Enabled: &enabled,
+		Contents: fmt.Sprintf(`[Unit]
+Description=Run EKS nodeadm pre/post bootstrap commands
+Before=nodeadm-run.service
+
+[Service]
+Type=oneshot
+ExecStart=%s
+RemainAfterExit=true
+
+[Install]
+WantedBy=multi-user.target
+`, bootstrapScriptPath),
+	}
+	return unit, file, true
+}
+
+// fileToIgnition converts a cloud-init style file entry into an Ignition storage file.
+func fileToIgnition(f eksbootstrapv1.File) (ignitionFile, error) {
+	mode := 0o644
+	if f.Permissions != "" {
+		if parsed, err := parseOctal(f.Permissions); err == nil {
+			mode = parsed
+		}
+	}
+
+	content, err := decodeFileContent(f)
+	if err != nil {
+		return ignitionFile{}, err
+	}
+	return dataURLFile(f.Path, mode, string(content)), nil
+}
+
+// decodeFileContent returns the plain bytes backing f.Content, decoding it
+// first when f.Encoding says the content arrived pre-encoded. Ignition data
+// URLs are always base64 regardless of the source encoding, so an already
+// base64 (or gzip+base64) File would otherwise get base64-encoded a second
+// time and come out corrupted on disk.
+func decodeFileContent(f eksbootstrapv1.File) ([]byte, error) {
+	switch f.Encoding {
+	case eksbootstrapv1.Base64:
+		decoded, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %w", err)
+		}
+		return decoded, nil
+	case eksbootstrapv1.Gzip:
+		decoded, err := base64.StdEncoding.DecodeString(f.Content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %w", err)
+		}
+		r, err := gzip.NewReader(bytes.NewReader(decoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip content: %w", err)
+		}
+		defer r.Close()
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip content: %w", err)
+		}
+		return plain, nil
+	default:
+		return []byte(f.Content), nil
+	}
+}
+
+// dataURLFile builds an Ignition storage file entry whose contents are embedded
+// as a base64 data URL, the form Ignition consumers expect.
+func dataURLFile(path string, mode int, content string) ignitionFile {
+	overwrite := true
+	m := mode
+	return ignitionFile{
+		Path:      path,
+		Overwrite: &overwrite,
+		Mode:      &m,
+		Contents: ignitionFileContents{
+			Source: "data:;base64," + base64.StdEncoding.EncodeToString([]byte(content)),
+		},
+	}
+}
+
+func parseOctal(s string) (int, error) {
+	var mode int
+	_, err := fmt.Sscanf(s, "%o", &mode)
+	return mode, err
+}
+
+// filesystemIndexByDevice returns the index of the filesystems entry for
+// device, or -1 if none matches.
+func filesystemIndexByDevice(filesystems []ignitionFilesystem, device string) int {
+	for i := range filesystems {
+		if filesystems[i].Device == device {
+			return i
+		}
+	}
+	return -1
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func sshKeysToStrings(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	out := make([]string, len(keys))
+	copy(out, keys)
+	return out
+}
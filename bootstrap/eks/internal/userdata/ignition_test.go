@@ -0,0 +1,131 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"k8s.io/utils/ptr"
+	eksbootstrapv1 "sigs.k8s.io/cluster-api-provider-aws/v2/bootstrap/eks/api/v1beta2"
+)
+
+func TestFileToIgnitionDecodesEncodedContent(t *testing.T) {
+	g := NewWithT(t)
+
+	plain := "hello ignition"
+	b64 := base64.StdEncoding.EncodeToString([]byte(plain))
+
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte(plain))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(w.Close()).To(Succeed())
+	gzb64 := base64.StdEncoding.EncodeToString(gz.Bytes())
+
+	cases := []struct {
+		name string
+		file eksbootstrapv1.File
+	}{
+		{name: "plain", file: eksbootstrapv1.File{Path: "/etc/plain.conf", Content: plain}},
+		{name: "base64", file: eksbootstrapv1.File{Path: "/etc/b64.conf", Content: b64, Encoding: eksbootstrapv1.Base64}},
+		{name: "gzip", file: eksbootstrapv1.File{Path: "/etc/gz.conf", Content: gzb64, Encoding: eksbootstrapv1.Gzip}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ign, err := fileToIgnition(c.file)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			wantSource := "data:;base64," + base64.StdEncoding.EncodeToString([]byte(plain))
+			g.Expect(ign.Contents.Source).To(Equal(wantSource))
+		})
+	}
+}
+
+func TestNewIgnitionNodeRendersDiskSetupMountsAndUsers(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{
+		ClusterName:       "test-cluster",
+		APIServerEndpoint: "https://example.com",
+		CACert:            "test-ca-cert",
+		NodeGroupName:     "test-nodegroup",
+		Format:            FormatIgnition,
+		DiskSetup: &eksbootstrapv1.DiskSetup{
+			Partitions: []eksbootstrapv1.Partition{
+				{Device: "/dev/nvme1n1", Overwrite: ptr.To(true)},
+			},
+			Filesystems: []eksbootstrapv1.Filesystem{
+				{Device: "/dev/nvme1n1", Filesystem: "xfs", Label: "data", Overwrite: ptr.To(true)},
+			},
+		},
+		Mounts: []eksbootstrapv1.MountPoints{
+			{"/dev/nvme1n1", "/mnt/data"},
+			{"/dev/nvme2n1", "/mnt/unbacked"},
+		},
+		Users: []eksbootstrapv1.User{
+			{
+				Name:              "core",
+				Passwd:            ptr.To("hashed-password"),
+				Groups:            ptr.To("wheel,docker"),
+				Shell:             ptr.To("/bin/bash"),
+				SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA test"},
+			},
+		},
+	}
+
+	raw, err := newIgnitionNode(input)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	var cfg ignitionConfig
+	g.Expect(json.Unmarshal(raw, &cfg)).To(Succeed())
+
+	// A disk_setup partition becomes a single whole-device partition (number 1),
+	// not the table_type/layout value that shipped broken before 66728f4.
+	g.Expect(cfg.Storage.Disks).To(Equal([]ignitionDisk{
+		{Device: "/dev/nvme1n1", WipeTable: true, Partitions: []ignitionPartition{{Number: 1}}},
+	}))
+
+	// The mount naming /dev/nvme1n1 splices its path into that device's
+	// filesystem entry rather than becoming a disconnected directory.
+	g.Expect(cfg.Storage.Filesystems).To(Equal([]ignitionFilesystem{
+		{Device: "/dev/nvme1n1", Format: "xfs", Label: "data", WipeFilesystem: true, Path: "/mnt/data"},
+	}))
+
+	// The mount naming a device with no matching filesystem entry falls back
+	// to a plain directory.
+	g.Expect(cfg.Storage.Directories).To(Equal([]ignitionDirectory{
+		{Path: "/mnt/unbacked"},
+	}))
+
+	g.Expect(cfg.Passwd.Users).To(Equal([]ignitionUser{
+		{
+			Name:              "core",
+			PasswordHash:      "hashed-password",
+			SSHAuthorizedKeys: []string{"ssh-ed25519 AAAA test"},
+			Groups:            []string{"wheel", "docker"},
+			Shell:             "/bin/bash",
+		},
+	}))
+}
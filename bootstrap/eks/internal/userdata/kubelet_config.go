@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// KubeletConfig mirrors the subset of kubelet/config/v1beta1.KubeletConfiguration
+// fields nodeadm's NodeConfig.kubelet.config section accepts.
+type KubeletConfig struct {
+	RegistryPullQPS *int32
+	RegistryBurst   *int32
+	EventRecordQPS  *int32
+	KubeAPIQPS      *int32
+	KubeAPIBurst    *int32
+	PodsPerCore     *int32
+	SystemReserved  map[string]string
+	KubeReserved    map[string]string
+	EvictionHard    map[string]string
+	FeatureGates    map[string]bool
+}
+
+// kubeletConfigPromotions maps a KubeletExtraArgs flag name to a setter that
+// parses its value into the matching KubeletConfig field. Keys not listed here
+// fall back to being rendered as a `--key=value` flag.
+var kubeletConfigPromotions = map[string]func(cfg *KubeletConfig, value string) error{
+	"registry-qps":    func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.RegistryPullQPS, v) },
+	"registry-burst":  func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.RegistryBurst, v) },
+	"event-qps":       func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.EventRecordQPS, v) },
+	"kube-api-qps":    func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.KubeAPIQPS, v) },
+	"kube-api-burst":  func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.KubeAPIBurst, v) },
+	"pods-per-core":   func(cfg *KubeletConfig, v string) error { return setInt32Field(&cfg.PodsPerCore, v) },
+	"system-reserved": func(cfg *KubeletConfig, v string) error { cfg.SystemReserved = parseKeyValueList(v); return nil },
+	"kube-reserved":   func(cfg *KubeletConfig, v string) error { cfg.KubeReserved = parseKeyValueList(v); return nil },
+	"eviction-hard":   func(cfg *KubeletConfig, v string) error { cfg.EvictionHard = parseThresholdList(v); return nil },
+	"feature-gates": func(cfg *KubeletConfig, v string) error {
+		gates, err := parseFeatureGates(v)
+		if err != nil {
+			return err
+		}
+		cfg.FeatureGates = gates
+		return nil
+	},
+}
+
+// mergeKubeletExtraArgs promotes well-known KubeletExtraArgs keys into
+// input.KubeletConfig and leaves the rest in input.KubeletFlags to be rendered
+// as nodeadm `flags:` entries.
+func mergeKubeletExtraArgs(input *NodeInput) error {
+	input.KubeletFlags = make(map[string]string, len(input.KubeletExtraArgs))
+
+	for key, value := range input.KubeletExtraArgs {
+		if key == "node-labels" {
+			continue
+		}
+
+		setter, ok := kubeletConfigPromotions[key]
+		if !ok {
+			input.KubeletFlags[key] = value
+			continue
+		}
+
+		if input.KubeletConfig == nil {
+			input.KubeletConfig = &KubeletConfig{}
+		}
+		if err := setter(input.KubeletConfig, value); err != nil {
+			return fmt.Errorf("failed to parse kubelet extra arg %q=%q: %w", key, value, err)
+		}
+		klog.Warningf("promoting kubelet extra arg --%s=%s to NodeConfig.kubelet.config; set NodeInput.KubeletConfig directly to avoid this conversion", key, value)
+	}
+
+	return nil
+}
+
+func setInt32Field(dst **int32, value string) error {
+	n, err := strconv.ParseInt(value, 10, 32)
+	if err != nil {
+		return fmt.Errorf("expected an integer: %w", err)
+	}
+	i := int32(n)
+	*dst = &i
+	return nil
+}
+
+// parseKeyValueList parses a comma-separated key=value list, the format
+// kubelet flags like --system-reserved and --kube-reserved use.
+func parseKeyValueList(value string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		out[kv[0]] = kv[1]
+	}
+	return out
+}
+
+// parseThresholdList parses a comma-separated resource<threshold list, the
+// format kubelet flags like --eviction-hard and --eviction-soft use.
+func parseThresholdList(value string) map[string]string {
+	out := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		idx := strings.IndexByte(pair, '<')
+		if idx < 0 {
+			continue
+		}
+		out[pair[:idx]] = pair[idx+1:]
+	}
+	return out
+}
+
+// parseFeatureGates parses a comma-separated Gate=bool list, the format the
+// kubelet --feature-gates flag uses.
+func parseFeatureGates(value string) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid feature gate %q, expected Gate=true|false", pair)
+		}
+		b, err := strconv.ParseBool(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid feature gate value %q: %w", pair, err)
+		}
+		out[kv[0]] = b
+	}
+	return out, nil
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewNodePromotesKubeletExtraArgs(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{
+		ClusterName:       "test-cluster",
+		APIServerEndpoint: "https://example.com",
+		CACert:            "test-ca-cert",
+		NodeGroupName:     "test-nodegroup",
+		KubeletExtraArgs: map[string]string{
+			"node-labels":          "env=prod",
+			"eviction-hard":        "memory.available<100Mi,nodefs.available<10%",
+			"system-reserved":      "cpu=100m,memory=100Mi",
+			"kube-api-qps":         "10",
+			"feature-gates":        "RotateKubeletServerCertificate=true",
+			"register-with-taints": "dedicated=infra:NoSchedule",
+		},
+	}
+
+	out, err := NewNode(input)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	output := string(out)
+	g.Expect(output).To(ContainSubstring("evictionHard:"))
+	g.Expect(output).To(ContainSubstring("memory.available: 100Mi"))
+	g.Expect(output).To(ContainSubstring("systemReserved:"))
+	g.Expect(output).To(ContainSubstring("cpu: 100m"))
+	g.Expect(output).To(ContainSubstring("kubeAPIQPS: 10"))
+	g.Expect(output).To(ContainSubstring("featureGates:"))
+	g.Expect(output).To(ContainSubstring("RotateKubeletServerCertificate: true"))
+	g.Expect(output).To(ContainSubstring(`--register-with-taints=dedicated=infra:NoSchedule`))
+	g.Expect(strings.Contains(output, `--eviction-hard=`)).To(BeFalse())
+}
+
+func TestMergeKubeletExtraArgsInvalidValue(t *testing.T) {
+	g := NewWithT(t)
+
+	input := &NodeInput{KubeletExtraArgs: map[string]string{"kube-api-qps": "not-a-number"}}
+	err := mergeKubeletExtraArgs(input)
+	g.Expect(err).To(HaveOccurred())
+}
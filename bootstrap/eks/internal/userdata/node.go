@@ -18,7 +18,9 @@ package userdata
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"strings"
 	"text/template"
 
@@ -72,12 +74,9 @@ set -o nounset
 {{- end}}
 --{{ .Boundary }}--`
 
-	// Node config part template for nodeadm.
-	nodeConfigPartTemplate = `
---{{.Boundary}}
-Content-Type: application/node.eks.aws
-
----
+	// nodeConfigYAMLTemplate is the nodeadm NodeConfig document shared by the
+	// cloud-config MIME part and the Ignition storage file variant.
+	nodeConfigYAMLTemplate = `---
 apiVersion: node.eks.aws/v1alpha1
 kind: NodeConfig
 spec:
@@ -85,7 +84,13 @@ spec:
     name: {{.ClusterName}}
     apiServerEndpoint: {{.APIServerEndpoint}}
     certificateAuthority: {{.CACert}}
-    cidr: {{if .ServiceCIDR}}{{.ServiceCIDR}}{{else}}172.20.0.0/16{{end}}
+    cidr: {{.ServiceCIDROrDefault}}
+    {{- with .IPFamilyString }}
+    ipFamily: {{.}}
+    {{- end }}
+    {{- with .ServiceIPV6Cidr }}
+    serviceIPv6Cidr: {{.}}
+    {{- end }}
   kubelet:
     config:
       maxPods: {{.MaxPods}}
@@ -93,19 +98,97 @@ spec:
       clusterDNS:
       - {{.}}
       {{- end }}
+      {{- with .KubeletConfig }}
+      {{- with .RegistryPullQPS }}
+      registryPullQPS: {{.}}
+      {{- end }}
+      {{- with .RegistryBurst }}
+      registryBurst: {{.}}
+      {{- end }}
+      {{- with .EventRecordQPS }}
+      eventRecordQPS: {{.}}
+      {{- end }}
+      {{- with .KubeAPIQPS }}
+      kubeAPIQPS: {{.}}
+      {{- end }}
+      {{- with .KubeAPIBurst }}
+      kubeAPIBurst: {{.}}
+      {{- end }}
+      {{- with .PodsPerCore }}
+      podsPerCore: {{.}}
+      {{- end }}
+      {{- with .SystemReserved }}
+      systemReserved:
+        {{- range $key, $value := . }}
+        {{$key}}: {{$value}}
+        {{- end }}
+      {{- end }}
+      {{- with .KubeReserved }}
+      kubeReserved:
+        {{- range $key, $value := . }}
+        {{$key}}: {{$value}}
+        {{- end }}
+      {{- end }}
+      {{- with .EvictionHard }}
+      evictionHard:
+        {{- range $key, $value := . }}
+        {{$key}}: {{$value}}
+        {{- end }}
+      {{- end }}
+      {{- with .FeatureGates }}
+      featureGates:
+        {{- range $key, $value := . }}
+        {{$key}}: {{$value}}
+        {{- end }}
+      {{- end }}
+      {{- end }}
     flags:
     - "--node-labels={{.NodeLabels}}"
-    {{- range $key, $value := .KubeletExtraArgs }}
-    {{- if ne $key "node-labels" }}
+    {{- range $key, $value := .KubeletFlags }}
     - "--{{$key}}={{$value}}"
     {{- end }}
-    {{- end }}
+`
 
+	// Node config part template for nodeadm.
+	nodeConfigPartTemplate = `
+--{{.Boundary}}
+Content-Type: application/node.eks.aws
+
+{{template "nodeconfig" .}}
 --{{.Boundary}}--`
 
 	nodeLabelImage        = "eks.amazonaws.com/nodegroup-image=%s"
 	nodeLabelNodeGroup    = "eks.amazonaws.com/nodegroup=%s"
 	nodeLabelCapacityType = "eks.amazonaws.com/capacityType=%s"
+
+	// defaultServiceCIDRIPv4 and defaultServiceCIDRIPv6 are used when the caller
+	// didn't supply a ServiceCIDR and it couldn't be resolved from the cluster
+	// (see cidr_resolver.go), matching the well-known EKS defaults for each family.
+	defaultServiceCIDRIPv4 = "172.20.0.0/16"
+	defaultServiceCIDRIPv6 = "fd00:ec2::/108"
+)
+
+// IPFamily is the IP family of the cluster the node is joining.
+type IPFamily string
+
+const (
+	// IPFamilyIPv4 is an IPv4-only cluster.
+	IPFamilyIPv4 IPFamily = "ipv4"
+	// IPFamilyIPv6 is an IPv6-only cluster.
+	IPFamilyIPv6 IPFamily = "ipv6"
+	// IPFamilyDual is a dual-stack cluster.
+	IPFamilyDual IPFamily = "dual"
+)
+
+// Format identifies the userdata encoding NewNode should produce.
+type Format string
+
+const (
+	// FormatCloudConfig renders MIME-multipart cloud-init userdata. This is the default.
+	FormatCloudConfig Format = "cloud-config"
+	// FormatIgnition renders an Ignition (v3.x) JSON config for operating systems,
+	// such as Flatcar, that don't ingest cloud-init.
+	FormatIgnition Format = "ignition"
 )
 
 // NodeInput contains all the information required to generate user data for a node.
@@ -119,10 +202,25 @@ type NodeInput struct {
 	PauseContainerAccount *string
 	PauseContainerVersion *string
 	UseMaxPods            *bool
-	// NOTE: currently the IPFamily/ServiceIPV6Cidr isn't exposed to the user.
-	// TODO (richardcase): remove the above comment when IPV6 / dual stack is implemented.
-	IPFamily                 *string
-	ServiceIPV6Cidr          *string
+	// Format selects the userdata encoding. Defaults to FormatCloudConfig when unset.
+	Format Format
+	// Compression selects whether the rendered userdata is gzipped to stay
+	// under the EC2 user data size limit. Defaults to CompressionNone when unset.
+	Compression CompressionMode
+	// S3Offload, when set, uploads Files entries larger than its Threshold to
+	// S3 and replaces them in userdata with a presigned-GET fetch command.
+	S3Offload *S3FileOffload
+	// IPFamily is the IP family of the cluster. Defaults to IPFamilyIPv4 when unset.
+	IPFamily        *IPFamily
+	ServiceIPV6Cidr *string
+	// EKSClient, when set, is used to resolve ServiceCIDR from the EKS cluster
+	// via DescribeCluster if the caller didn't supply one.
+	EKSClient EKSDescribeClusterAPI
+	// KubeletConfig holds structured KubeletConfiguration fields rendered under
+	// NodeConfig.kubelet.config. Well-known KubeletExtraArgs keys (e.g.
+	// eviction-hard, system-reserved) are merged into it automatically; set it
+	// directly to avoid that conversion.
+	KubeletConfig            *KubeletConfig
 	PreBootstrapCommands     []string
 	PostBootstrapCommands    []string
 	BootstrapCommandOverride *string
@@ -141,7 +239,8 @@ type NodeInput struct {
 	ClusterDNS        string
 	MaxPods           *int32
 	NodeGroupName     string
-	NodeLabels        string // Not exposed in CRD, computed from user input
+	NodeLabels        string            // Not exposed in CRD, computed from user input
+	KubeletFlags      map[string]string // Not exposed in CRD, computed from KubeletExtraArgs
 }
 
 // PauseContainerInfo holds pause container information for templates.
@@ -150,12 +249,32 @@ type PauseContainerInfo struct {
 	Version       *string
 }
 
+// RenderOptions configures how NewNode renders userdata.
+type RenderOptions struct {
+	// Registry supplies the ordered set of template parts to render. When nil,
+	// NewNode renders the package-level default registry (see RegisterPart).
+	Registry *PartRegistry
+}
+
 // NewNode returns the user data string to be used on a node instance.
-func NewNode(input *NodeInput) ([]byte, error) {
+func NewNode(input *NodeInput, opts ...RenderOptions) ([]byte, error) {
 	if err := validateNodeInput(input); err != nil {
 		return nil, err
 	}
 
+	if input.Format == FormatIgnition {
+		raw, err := newIgnitionNode(input)
+		if err != nil {
+			return nil, err
+		}
+		return finalizeUserData(input, raw)
+	}
+
+	registry := defaultRegistry
+	if len(opts) > 0 && opts[0].Registry != nil {
+		registry = opts[0].Registry
+	}
+
 	var buf bytes.Buffer
 
 	// Write MIME header
@@ -163,61 +282,127 @@ func NewNode(input *NodeInput) ([]byte, error) {
 		return nil, fmt.Errorf("failed to write MIME header: %v", err)
 	}
 
-	// Write shell script part if needed
-	if len(input.PreBootstrapCommands) > 0 || len(input.PostBootstrapCommands) > 0 {
-		shellScriptTemplate := template.Must(template.New("shell").Parse(shellScriptPartTemplate))
-		if err := shellScriptTemplate.Execute(&buf, input); err != nil {
-			return nil, fmt.Errorf("failed to execute shell script template: %v", err)
-		}
-		if _, err := buf.WriteString("\n"); err != nil {
-			return nil, fmt.Errorf("failed to write newline: %v", err)
+	for _, part := range registry.Parts() {
+		if err := renderPart(&buf, input, part); err != nil {
+			return nil, err
 		}
 	}
 
-	// Write node config part
-	nodeConfigTemplate := template.Must(template.New("node").Parse(nodeConfigPartTemplate))
-	if err := nodeConfigTemplate.Execute(&buf, input); err != nil {
-		return nil, fmt.Errorf("failed to execute node config template: %v", err)
+	return finalizeUserData(input, buf.Bytes())
+}
+
+// renderPart executes a single registered template part against input and
+// appends its output to buf. A part whose Data func returns nil is skipped
+// entirely (e.g. the shell script part when there are no commands to run).
+func renderPart(buf *bytes.Buffer, input *NodeInput, part TemplatePart) error {
+	dataFn := part.Data
+	if dataFn == nil {
+		dataFn = func(ni *NodeInput) any { return ni }
+	}
+	data := dataFn(input)
+	if data == nil {
+		return nil
 	}
 
-	// Write cloud-config part
-	tm := template.New("Node").Funcs(defaultTemplateFuncMap)
-	// if any of the input fields are set, we need to write the cloud-config part
-	if input.NTP != nil || input.DiskSetup != nil || input.Mounts != nil || input.Users != nil {
-		if _, err := tm.Parse(filesTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse args template: %w", err)
-		}
-		if _, err := tm.Parse(ntpTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse ntp template: %w", err)
+	tm := template.New(part.Name).Funcs(defaultTemplateFuncMap)
+	for name, sub := range part.SubTemplates {
+		if _, err := tm.New(name).Parse(sub); err != nil {
+			return fmt.Errorf("failed to parse %q sub-template for part %q: %w", name, part.Name, err)
 		}
+	}
+	if _, err := tm.Parse(part.Template); err != nil {
+		return fmt.Errorf("failed to parse template for part %q: %w", part.Name, err)
+	}
+	if err := tm.Execute(buf, data); err != nil {
+		return fmt.Errorf("failed to execute template for part %q: %w", part.Name, err)
+	}
+	if _, err := buf.WriteString("\n"); err != nil {
+		return fmt.Errorf("failed to write newline after part %q: %w", part.Name, err)
+	}
+	return nil
+}
 
-		if _, err := tm.Parse(usersTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse users template: %w", err)
-		}
+// renderNodeConfigYAML renders the nodeadm NodeConfig document on its own, without
+// the surrounding MIME part, so it can be embedded as a file in other userdata formats.
+func renderNodeConfigYAML(input *NodeInput) (string, error) {
+	var buf bytes.Buffer
+	tmpl := template.Must(template.New("nodeconfig").Parse(nodeConfigYAMLTemplate))
+	if err := tmpl.Execute(&buf, input); err != nil {
+		return "", fmt.Errorf("failed to execute node config template: %v", err)
+	}
+	return buf.String(), nil
+}
 
-		if _, err := tm.Parse(diskSetupTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse disk setup template: %w", err)
-		}
+// ServiceCIDROrDefault returns the configured ServiceCIDR, or the well-known EKS
+// default for the configured IP family when ServiceCIDR wasn't set or resolved.
+func (ni *NodeInput) ServiceCIDROrDefault() string {
+	if ni.ServiceCIDR != "" {
+		return ni.ServiceCIDR
+	}
+	if ni.IPFamily != nil && *ni.IPFamily == IPFamilyIPv6 {
+		return defaultServiceCIDRIPv6
+	}
+	return defaultServiceCIDRIPv4
+}
 
-		if _, err := tm.Parse(fsSetupTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse fs setup template: %w", err)
-		}
+// dnsServiceCIDR returns the service CIDR that the cluster DNS service IP
+// should be derived from. EKS dual-stack clusters are IPv6-primary for
+// services, so clusterDNS comes from ServiceIPV6Cidr rather than the IPv4
+// ServiceCIDR even though both are populated.
+func (ni *NodeInput) dnsServiceCIDR() string {
+	if ni.IPFamily != nil && (*ni.IPFamily == IPFamilyIPv6 || *ni.IPFamily == IPFamilyDual) &&
+		ni.ServiceIPV6Cidr != nil && *ni.ServiceIPV6Cidr != "" {
+		return *ni.ServiceIPV6Cidr
+	}
+	return ni.ServiceCIDROrDefault()
+}
 
-		if _, err := tm.Parse(mountsTemplate); err != nil {
-			return nil, fmt.Errorf("failed to parse mounts template: %w", err)
-		}
+// IPFamilyString returns the configured IP family as a string, or "" when unset,
+// for use in templates.
+func (ni *NodeInput) IPFamilyString() string {
+	if ni.IPFamily == nil {
+		return ""
+	}
+	return string(*ni.IPFamily)
+}
+
+// validateIPFamily checks that IPFamily, ServiceCIDR and ServiceIPV6Cidr agree
+// with each other when more than one is set.
+func validateIPFamily(input *NodeInput) error {
+	if input.IPFamily == nil {
+		return nil
+	}
 
-		t, err := tm.Parse(nodeUserData)
+	var isIPv6CIDR bool
+	if input.ServiceCIDR != "" {
+		_, network, err := net.ParseCIDR(input.ServiceCIDR)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse Node template: %w", err)
+			return fmt.Errorf("invalid service CIDR %q: %w", input.ServiceCIDR, err)
 		}
+		isIPv6CIDR = network.IP.To4() == nil
+	}
 
-		if err := t.Execute(&buf, input); err != nil {
-			return nil, fmt.Errorf("failed to execute node user data template: %w", err)
+	switch *input.IPFamily {
+	case IPFamilyIPv4:
+		if isIPv6CIDR {
+			return fmt.Errorf("IPFamily is %q but ServiceCIDR %q is an IPv6 CIDR", IPFamilyIPv4, input.ServiceCIDR)
+		}
+	case IPFamilyIPv6:
+		if input.ServiceCIDR != "" && !isIPv6CIDR {
+			return fmt.Errorf("IPFamily is %q but ServiceCIDR %q is an IPv4 CIDR", IPFamilyIPv6, input.ServiceCIDR)
+		}
+	case IPFamilyDual:
+		if isIPv6CIDR {
+			return fmt.Errorf("IPFamily is %q but ServiceCIDR %q is an IPv6 CIDR; dual-stack expects the IPv4 CIDR in ServiceCIDR and the IPv6 CIDR in ServiceIPV6Cidr", IPFamilyDual, input.ServiceCIDR)
 		}
+		if input.ServiceIPV6Cidr == nil || *input.ServiceIPV6Cidr == "" {
+			return fmt.Errorf("IPFamily is %q but ServiceIPV6Cidr is not set", IPFamilyDual)
+		}
+	default:
+		return fmt.Errorf("unsupported IPFamily %q", *input.IPFamily)
 	}
-	return buf.Bytes(), nil
 
+	return nil
 }
 
 // getNodeLabels returns the string representation of node-labels flags for nodeadm.
@@ -272,10 +457,71 @@ func validateNodeInput(input *NodeInput) error {
 		return fmt.Errorf("node group name is required for nodeadm")
 	}
 
+	if input.ServiceCIDR == "" && input.EKSClient != nil {
+		cidr, err := resolveClusterServiceCIDR(context.Background(), input.EKSClient, input.ClusterName)
+		if err != nil {
+			return fmt.Errorf("failed to resolve service CIDR for cluster %q: %w", input.ClusterName, err)
+		}
+
+		// resolvedFamily is Dual only when DescribeCluster returned both CIDRs;
+		// a cluster that only returned one of them can't satisfy Dual, even if
+		// the caller asked for it.
+		var resolvedFamily IPFamily
+		switch {
+		case cidr.IPv4 != "" && cidr.IPv6 != "":
+			resolvedFamily = IPFamilyDual
+		case cidr.IPv6 != "":
+			resolvedFamily = IPFamilyIPv6
+		case cidr.IPv4 != "":
+			resolvedFamily = IPFamilyIPv4
+		default:
+			return fmt.Errorf("cluster %q returned no service CIDR", input.ClusterName)
+		}
+
+		if input.IPFamily == nil {
+			input.IPFamily = ptr.To(resolvedFamily)
+		} else if *input.IPFamily != resolvedFamily {
+			if *input.IPFamily == IPFamilyDual {
+				return fmt.Errorf("cluster %q resolved as IP family %q, which can't satisfy dual-stack; dual-stack auto-resolution requires DescribeCluster to return both an IPv4 and IPv6 service CIDR", input.ClusterName, resolvedFamily)
+			}
+			return fmt.Errorf("cluster %q resolved as IP family %q but caller set IPFamily %q", input.ClusterName, resolvedFamily, *input.IPFamily)
+		}
+
+		switch resolvedFamily {
+		case IPFamilyDual:
+			input.ServiceCIDR = cidr.IPv4
+			if input.ServiceIPV6Cidr == nil || *input.ServiceIPV6Cidr == "" {
+				input.ServiceIPV6Cidr = ptr.To(cidr.IPv6)
+			}
+		case IPFamilyIPv6:
+			input.ServiceCIDR = cidr.IPv6
+		default:
+			input.ServiceCIDR = cidr.IPv4
+		}
+	}
+
+	if err := validateIPFamily(input); err != nil {
+		return err
+	}
+
+	if input.DNSClusterIP == nil {
+		dnsIP, err := deriveDNSClusterIP(input.dnsServiceCIDR())
+		if err != nil {
+			return fmt.Errorf("failed to derive cluster DNS IP for cluster %q: %w", input.ClusterName, err)
+		}
+		input.DNSClusterIP = &dnsIP
+	}
+
 	if input.MaxPods == nil {
-		if input.UseMaxPods != nil && *input.UseMaxPods {
+		switch {
+		case input.IPFamily != nil && (*input.IPFamily == IPFamilyIPv6 || *input.IPFamily == IPFamilyDual):
+			// IPv6 (and dual-stack) nodegroups always run the VPC CNI with prefix
+			// delegation enabled, so they default to the higher prefix-delegated
+			// pod density regardless of UseMaxPods.
 			input.MaxPods = ptr.To[int32](110)
-		} else {
+		case input.UseMaxPods != nil && *input.UseMaxPods:
+			input.MaxPods = ptr.To[int32](110)
+		default:
 			input.MaxPods = ptr.To[int32](58)
 		}
 	}
@@ -286,6 +532,31 @@ func validateNodeInput(input *NodeInput) error {
 	if input.Boundary == "" {
 		input.Boundary = boundary
 	}
+
+	switch input.Format {
+	case "":
+		input.Format = FormatCloudConfig
+	case FormatCloudConfig, FormatIgnition:
+	default:
+		return fmt.Errorf("unsupported userdata format %q", input.Format)
+	}
+
+	switch input.Compression {
+	case "":
+		input.Compression = CompressionNone
+	case CompressionNone, CompressionGzip:
+	default:
+		return fmt.Errorf("unsupported userdata compression %q", input.Compression)
+	}
+
+	if err := offloadLargeFiles(context.Background(), input); err != nil {
+		return err
+	}
+
+	if err := mergeKubeletExtraArgs(input); err != nil {
+		return err
+	}
+
 	input.NodeLabels = input.getNodeLabels()
 
 	klog.V(2).Infof("Nodeadm Userdata Generation - maxPods: %d, node-labels: %s",
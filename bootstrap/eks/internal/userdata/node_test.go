@@ -194,6 +194,207 @@ func TestNewNode(t *testing.T) {
 			},
 			expectErr: true,
 		},
+		{
+			name: "ignition format",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					Format:            FormatIgnition,
+					PreBootstrapCommands: []string{
+						"echo 'pre-bootstrap'",
+					},
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, `"version":"3.4.0"`) &&
+					strings.Contains(output, `"path":"/etc/eks/nodeadm/config.yaml"`) &&
+					strings.Contains(output, `"name":"eks-bootstrap-commands.service"`)
+			},
+		},
+		{
+			name: "service CIDR resolution failure fails hard",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					EKSClient:         &fakeDescribeClusterAPI{errOut: fmt.Errorf("boom")},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "ipv6 only cluster",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyIPv6),
+					ServiceCIDR:       "fd00:ec2::/108",
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, "ipFamily: ipv6") &&
+					strings.Contains(output, "cidr: fd00:ec2::/108") &&
+					strings.Contains(output, "clusterDNS:\n      - fd00:ec2::a") &&
+					strings.Contains(output, "maxPods: 110")
+			},
+		},
+		{
+			name: "ipv6 only cluster with no explicit service cidr",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyIPv6),
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, "ipFamily: ipv6") &&
+					strings.Contains(output, "cidr: fd00:ec2::/108") &&
+					strings.Contains(output, "clusterDNS:\n      - fd00:ec2::a") &&
+					strings.Contains(output, "maxPods: 110")
+			},
+		},
+		{
+			name: "dual stack cluster",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyDual),
+					ServiceCIDR:       "10.100.0.0/16",
+					ServiceIPV6Cidr:   ptr.To("fd00:ec2::/108"),
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, "ipFamily: dual") &&
+					strings.Contains(output, "cidr: 10.100.0.0/16") &&
+					strings.Contains(output, "serviceIPv6Cidr: fd00:ec2::/108") &&
+					strings.Contains(output, "clusterDNS:\n      - fd00:ec2::a") &&
+					strings.Contains(output, "maxPods: 110")
+			},
+		},
+		{
+			name: "conflicting IPv4 CIDR with ipv6 family",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyIPv6),
+					ServiceCIDR:       "10.100.0.0/16",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "dual stack missing IPv6 CIDR",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyDual),
+					ServiceCIDR:       "10.100.0.0/16",
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "resolved service cidr does not overwrite caller-supplied IPFamily",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyIPv4),
+					EKSClient:         &fakeDescribeClusterAPI{ipv4: "10.100.0.0/16"},
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, "ipFamily: ipv4") &&
+					strings.Contains(output, "cidr: 10.100.0.0/16")
+			},
+		},
+		{
+			name: "resolved service cidr conflicts with caller-supplied IPFamily",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyIPv4),
+					EKSClient:         &fakeDescribeClusterAPI{ipv6: "fd00:ec2::/108"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "dual stack cluster resolved via EKSClient",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					EKSClient:         &fakeDescribeClusterAPI{ipv4: "10.100.0.0/16", ipv6: "fd00:ec2::/108"},
+				},
+			},
+			expectErr: false,
+			verifyOutput: func(output string) bool {
+				return strings.Contains(output, "ipFamily: dual") &&
+					strings.Contains(output, "cidr: 10.100.0.0/16") &&
+					strings.Contains(output, "serviceIPv6Cidr: fd00:ec2::/108") &&
+					strings.Contains(output, "clusterDNS:\n      - fd00:ec2::a")
+			},
+		},
+		{
+			name: "dual stack family requested but cluster only resolves one CIDR",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					IPFamily:          ptr.To(IPFamilyDual),
+					EKSClient:         &fakeDescribeClusterAPI{ipv4: "10.100.0.0/16"},
+				},
+			},
+			expectErr: true,
+		},
+		{
+			name: "unsupported format",
+			args: args{
+				input: &NodeInput{
+					ClusterName:       "test-cluster",
+					APIServerEndpoint: "https://example.com",
+					CACert:            "test-ca-cert",
+					NodeGroupName:     "test-nodegroup",
+					Format:            Format("toml"),
+				},
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, testcase := range tests {
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import "sync"
+
+// TemplatePart is a single MIME part NewNode renders into the cloud-config
+// userdata. Parts are rendered in registration order.
+type TemplatePart struct {
+	// Name identifies the part and is used as its root template name.
+	Name string
+	// Template is the text/template source rendered for this part.
+	Template string
+	// SubTemplates are additional named templates Template may reference via
+	// {{template "name" .}}, e.g. the nodeadm NodeConfig body or the
+	// cloud-config files/ntp/users/disk_setup/fs_setup/mounts snippets.
+	SubTemplates map[string]string
+	// Data returns the value Template is executed against. Returning nil skips
+	// rendering this part, e.g. the shell script part when there are no
+	// bootstrap commands to run.
+	Data func(*NodeInput) any
+}
+
+// PartRegistry is an ordered, named collection of TemplateParts.
+type PartRegistry struct {
+	mu    sync.Mutex
+	order []string
+	parts map[string]TemplatePart
+}
+
+// NewPartRegistry returns an empty PartRegistry.
+func NewPartRegistry() *PartRegistry {
+	return &PartRegistry{parts: map[string]TemplatePart{}}
+}
+
+// RegisterTemplatePart registers part on the registry. Registering a name that
+// already exists replaces that part in place, without changing its render
+// order relative to the other registered parts.
+func (r *PartRegistry) RegisterTemplatePart(part TemplatePart) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.parts[part.Name]; !exists {
+		r.order = append(r.order, part.Name)
+	}
+	r.parts[part.Name] = part
+}
+
+// RegisterPart is a convenience wrapper around RegisterTemplatePart for parts
+// that don't need SubTemplates.
+func (r *PartRegistry) RegisterPart(name string, tmpl string, data func(*NodeInput) any) {
+	r.RegisterTemplatePart(TemplatePart{Name: name, Template: tmpl, Data: data})
+}
+
+// Parts returns the registered parts in render order.
+func (r *PartRegistry) Parts() []TemplatePart {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]TemplatePart, 0, len(r.order))
+	for _, name := range r.order {
+		out = append(out, r.parts[name])
+	}
+	return out
+}
+
+// DefaultShellPart renders PreBootstrapCommands/PostBootstrapCommands as the
+// nodeadm shell-script MIME part. Skipped when neither is set.
+var DefaultShellPart = TemplatePart{
+	Name:     "shell",
+	Template: shellScriptPartTemplate,
+	Data: func(input *NodeInput) any {
+		if len(input.PreBootstrapCommands) == 0 && len(input.PostBootstrapCommands) == 0 {
+			return nil
+		}
+		return input
+	},
+}
+
+// DefaultNodeConfigPart renders the nodeadm NodeConfig MIME part. Always rendered.
+var DefaultNodeConfigPart = TemplatePart{
+	Name:         "node",
+	Template:     nodeConfigPartTemplate,
+	SubTemplates: map[string]string{"nodeconfig": nodeConfigYAMLTemplate},
+	Data:         func(input *NodeInput) any { return input },
+}
+
+// DefaultCloudConfigPart renders the NTP/users/disk-setup/mounts cloud-config
+// MIME part. Skipped unless one of those fields is set.
+var DefaultCloudConfigPart = TemplatePart{
+	Name:     "Node",
+	Template: nodeUserData,
+	SubTemplates: map[string]string{
+		"files":      filesTemplate,
+		"ntp":        ntpTemplate,
+		"users":      usersTemplate,
+		"disk_setup": diskSetupTemplate,
+		"fs_setup":   fsSetupTemplate,
+		"mounts":     mountsTemplate,
+	},
+	Data: func(input *NodeInput) any {
+		if input.NTP == nil && input.DiskSetup == nil && input.Mounts == nil && input.Users == nil {
+			return nil
+		}
+		return input
+	},
+}
+
+// NewDefaultRegistry returns a PartRegistry populated with the parts NewNode
+// has always rendered: the shell script, the nodeadm NodeConfig, and the
+// cloud-config document. Pass it via RenderOptions.Registry (after registering
+// additional parts, or replacing a default one) to customize a single NewNode
+// call without touching the package-level default registry.
+func NewDefaultRegistry() *PartRegistry {
+	r := NewPartRegistry()
+	r.RegisterTemplatePart(DefaultShellPart)
+	r.RegisterTemplatePart(DefaultNodeConfigPart)
+	r.RegisterTemplatePart(DefaultCloudConfigPart)
+	return r
+}
+
+// defaultRegistry is the package-level registry NewNode renders when no
+// RenderOptions.Registry is supplied.
+var defaultRegistry = NewDefaultRegistry()
+
+// RegisterPart registers an additional template part on the package-level
+// default registry used by NewNode, so downstream consumers (e.g. a Cilium or
+// GPU-operator integration) can add extra MIME parts or NodeConfig snippets
+// without forking this package. Parts render in registration order after the
+// built-in shell, node config and cloud-config parts; re-registering one of
+// those names replaces it in place.
+func RegisterPart(name string, tmpl string, data func(*NodeInput) any) {
+	defaultRegistry.RegisterPart(name, tmpl, data)
+}
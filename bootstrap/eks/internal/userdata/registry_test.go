@@ -0,0 +1,69 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewNodeWithCustomRegistry(t *testing.T) {
+	g := NewWithT(t)
+
+	registry := NewDefaultRegistry()
+	registry.RegisterPart("cilium", `
+--{{.Boundary}}
+Content-Type: application/node.eks.aws
+
+---
+apiVersion: node.eks.aws/v1alpha1
+kind: NodeConfig
+spec:
+  containerd:
+    config: |
+      cilium-extra-snippet
+--{{.Boundary}}--`, func(input *NodeInput) any { return input })
+
+	input := &NodeInput{
+		ClusterName:       "test-cluster",
+		APIServerEndpoint: "https://example.com",
+		CACert:            "test-ca-cert",
+		NodeGroupName:     "test-nodegroup",
+	}
+
+	out, err := NewNode(input, RenderOptions{Registry: registry})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(strings.Contains(string(out), "cilium-extra-snippet")).To(BeTrue())
+}
+
+func TestRegisterPartReplacesDefaultInPlace(t *testing.T) {
+	g := NewWithT(t)
+
+	registry := NewDefaultRegistry()
+	registry.RegisterPart(DefaultShellPart.Name, `
+--{{.Boundary}}
+Content-Type: text/x-shellscript
+
+#!/bin/bash
+echo replaced
+--{{.Boundary}}--`, func(input *NodeInput) any { return input })
+
+	g.Expect(len(registry.Parts())).To(Equal(3))
+	g.Expect(registry.Parts()[0].Name).To(Equal(DefaultShellPart.Name))
+}
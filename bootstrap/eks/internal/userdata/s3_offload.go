@@ -0,0 +1,128 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	eksbootstrapv1 "sigs.k8s.io/cluster-api-provider-aws/v2/bootstrap/eks/api/v1beta2"
+)
+
+// defaultS3OffloadThreshold is the S3FileOffload.Threshold used when unset.
+const defaultS3OffloadThreshold = 2 * 1024
+
+// S3FileOffloadAPI is the subset of the S3 client S3FileOffload needs: upload
+// the file content, then presign a GET so the instance can fetch it back.
+type S3FileOffloadAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	PresignGetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// S3FileOffload offloads large NodeInput.Files entries to S3 so they don't
+// count against the EC2 user data size limit.
+type S3FileOffload struct {
+	Client    S3FileOffloadAPI
+	Bucket    string
+	KeyPrefix string
+	// Threshold is the file content size, in bytes, above which a file is
+	// offloaded to S3. Defaults to defaultS3OffloadThreshold when zero.
+	Threshold int
+}
+
+// offloadLargeFiles uploads any input.Files entry larger than the configured
+// threshold to S3, replacing it in userdata with a PreBootstrapCommands step
+// that fetches it back via a presigned GET URL.
+func offloadLargeFiles(ctx context.Context, input *NodeInput) error {
+	if input.S3Offload == nil || input.S3Offload.Client == nil || len(input.Files) == 0 {
+		return nil
+	}
+
+	threshold := input.S3Offload.Threshold
+	if threshold <= 0 {
+		threshold = defaultS3OffloadThreshold
+	}
+
+	var fetchCommands []string
+	remaining := input.Files[:0]
+	for _, f := range input.Files {
+		if len(f.Content) <= threshold {
+			remaining = append(remaining, f)
+			continue
+		}
+
+		key := path.Join(input.S3Offload.KeyPrefix, input.ClusterName, input.NodeGroupName, strings.TrimPrefix(f.Path, "/"))
+		if _, err := input.S3Offload.Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(input.S3Offload.Bucket),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(f.Content),
+		}); err != nil {
+			return fmt.Errorf("failed to upload userdata file %q to s3://%s/%s: %w", f.Path, input.S3Offload.Bucket, key, err)
+		}
+
+		presigned, err := input.S3Offload.Client.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(input.S3Offload.Bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to presign GET for userdata file %q: %w", f.Path, err)
+		}
+
+		mode := f.Permissions
+		if mode == "" {
+			mode = "0644"
+		}
+		fetchCommands = append(fetchCommands, offloadFetchCommand(f, presigned.URL, mode))
+	}
+	input.Files = remaining
+
+	// Files normally materialize before any pre-bootstrap command runs (cloud-init
+	// write_files/Ignition storage.files both land before the shell stage), so the
+	// fetch commands that restore offloaded files must run ahead of the caller's
+	// own PreBootstrapCommands, not after.
+	if len(fetchCommands) > 0 {
+		input.PreBootstrapCommands = append(fetchCommands, input.PreBootstrapCommands...)
+	}
+
+	return nil
+}
+
+// offloadFetchCommand builds the shell command a node runs to fetch an
+// offloaded file back from S3 and write it to disk. The file is uploaded to
+// S3 exactly as it arrived in f.Content, so the fetch command has to reverse
+// whatever f.Encoding applied, otherwise an already base64 (or gzip+base64)
+// file would be written to disk still encoded.
+func offloadFetchCommand(f eksbootstrapv1.File, url, mode string) string {
+	fetch := fmt.Sprintf("curl -fsSL %q", url)
+	switch f.Encoding {
+	case eksbootstrapv1.Base64:
+		return fmt.Sprintf("mkdir -p %q && %s | base64 -d > %q && chmod %s %q",
+			path.Dir(f.Path), fetch, f.Path, mode, f.Path)
+	case eksbootstrapv1.Gzip:
+		return fmt.Sprintf("mkdir -p %q && %s | base64 -d | gunzip > %q && chmod %s %q",
+			path.Dir(f.Path), fetch, f.Path, mode, f.Path)
+	default:
+		return fmt.Sprintf("mkdir -p %q && %s -o %q && chmod %s %q",
+			path.Dir(f.Path), fetch, f.Path, mode, f.Path)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdata
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	. "github.com/onsi/gomega"
+
+	eksbootstrapv1 "sigs.k8s.io/cluster-api-provider-aws/v2/bootstrap/eks/api/v1beta2"
+)
+
+type fakeS3FileOffloadAPI struct {
+	puts int
+}
+
+func (f *fakeS3FileOffloadAPI) PutObject(_ context.Context, _ *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.puts++
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3FileOffloadAPI) PresignGetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	return &v4.PresignedHTTPRequest{URL: "https://example-bucket.s3.amazonaws.com/" + *params.Key + "?X-Amz-Signature=fake"}, nil
+}
+
+func TestOffloadLargeFilesMovesLargeFilesToS3(t *testing.T) {
+	g := NewWithT(t)
+
+	client := &fakeS3FileOffloadAPI{}
+	input := &NodeInput{
+		ClusterName:   "test-cluster",
+		NodeGroupName: "test-nodegroup",
+		S3Offload:     &S3FileOffload{Client: client, Bucket: "test-bucket", Threshold: 10},
+		Files: []eksbootstrapv1.File{
+			{Path: "/etc/small.conf", Content: "tiny"},
+			{Path: "/etc/large.conf", Content: strings.Repeat("x", 100), Permissions: "0600"},
+		},
+	}
+
+	g.Expect(offloadLargeFiles(context.Background(), input)).To(Succeed())
+	g.Expect(client.puts).To(Equal(1))
+	g.Expect(input.Files).To(HaveLen(1))
+	g.Expect(input.Files[0].Path).To(Equal("/etc/small.conf"))
+	g.Expect(input.PreBootstrapCommands).To(HaveLen(1))
+	g.Expect(input.PreBootstrapCommands[0]).To(ContainSubstring("curl -fsSL"))
+	g.Expect(input.PreBootstrapCommands[0]).To(ContainSubstring("/etc/large.conf"))
+}
+
+func TestOffloadLargeFilesPrependsFetchCommandsBeforeExistingPreBootstrapCommands(t *testing.T) {
+	g := NewWithT(t)
+
+	client := &fakeS3FileOffloadAPI{}
+	input := &NodeInput{
+		ClusterName:   "test-cluster",
+		NodeGroupName: "test-nodegroup",
+		S3Offload:     &S3FileOffload{Client: client, Bucket: "test-bucket", Threshold: 10},
+		Files: []eksbootstrapv1.File{
+			{Path: "/etc/large.conf", Content: strings.Repeat("x", 100)},
+		},
+		PreBootstrapCommands: []string{"echo 'user pre-bootstrap command'"},
+	}
+
+	g.Expect(offloadLargeFiles(context.Background(), input)).To(Succeed())
+	g.Expect(input.PreBootstrapCommands).To(HaveLen(2))
+	g.Expect(input.PreBootstrapCommands[0]).To(ContainSubstring("/etc/large.conf"))
+	g.Expect(input.PreBootstrapCommands[1]).To(Equal("echo 'user pre-bootstrap command'"))
+}
+
+func TestOffloadLargeFilesDecodesEncodedContentOnFetch(t *testing.T) {
+	g := NewWithT(t)
+
+	client := &fakeS3FileOffloadAPI{}
+	input := &NodeInput{
+		ClusterName:   "test-cluster",
+		NodeGroupName: "test-nodegroup",
+		S3Offload:     &S3FileOffload{Client: client, Bucket: "test-bucket", Threshold: 10},
+		Files: []eksbootstrapv1.File{
+			{Path: "/etc/b64.bin", Content: strings.Repeat("eA==", 10), Encoding: eksbootstrapv1.Base64},
+			{Path: "/etc/gz.bin", Content: strings.Repeat("eA==", 10), Encoding: eksbootstrapv1.Gzip},
+		},
+	}
+
+	g.Expect(offloadLargeFiles(context.Background(), input)).To(Succeed())
+	g.Expect(input.PreBootstrapCommands).To(HaveLen(2))
+	g.Expect(input.PreBootstrapCommands[0]).To(ContainSubstring("base64 -d > \"/etc/b64.bin\""))
+	g.Expect(input.PreBootstrapCommands[1]).To(ContainSubstring("base64 -d | gunzip > \"/etc/gz.bin\""))
+}